@@ -0,0 +1,129 @@
+// Package backend defines the interface cloud providers implement to give
+// jobs somewhere to run, and the registry that provider packages register
+// themselves with.
+package backend
+
+import (
+	goctx "context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/travis-ci/worker/config"
+)
+
+// ErrDownloadTraceNotImplemented is returned by Instance.DownloadTrace when a
+// backend has no way to retrieve the build trace file.
+var ErrDownloadTraceNotImplemented = errors.New("backend: downloading the trace file is not implemented for this provider")
+
+// StartAttributes describe the kind of instance a job asked for. Backends
+// are free to ignore any attributes they don't support.
+type StartAttributes struct {
+	Language  string
+	OS        string
+	ImageName string
+}
+
+// RunResult is the outcome of running a build script on an instance.
+// Completed is false when the connection to the instance was lost before the
+// script could finish; ExitCode is only meaningful when Completed is true.
+type RunResult struct {
+	Completed bool
+	ExitCode  uint8
+}
+
+// Progresser receives structured events describing an instance's startup, so
+// operators watching a build see feedback during a slow cold start instead
+// of a silent gap in the job log.
+type Progresser interface {
+	Progress(event ProgressEvent)
+}
+
+// ProgressEvent is a single stage transition reported to a Progresser while
+// an instance is starting up, e.g. "SSH key created" or "instance running".
+type ProgressEvent struct {
+	Message string
+	Elapsed time.Duration
+}
+
+// Instance is a single running build VM.
+type Instance interface {
+	UploadScript(ctx goctx.Context, script []byte) error
+	RunScript(ctx goctx.Context, output io.Writer) (*RunResult, error)
+	DownloadTrace(ctx goctx.Context) ([]byte, error)
+	Stop(ctx goctx.Context) error
+
+	ID() string
+	StartupDuration() time.Duration
+	ImageName() string
+	Warmed() bool
+	SupportsProgress() bool
+}
+
+// InstanceSet owns everything needed to talk to one provider config: API
+// credentials, retry policy, and a cancellable background context for
+// work that outlives any single Create call. It replaces the older
+// single-instance-at-a-time Provider interface so that:
+//
+//   - callers don't have to plumb a fresh context through every call; a
+//     provider's own background bookkeeping (warm pools, zone health,
+//     orphan reaping) runs against the set's own context instead
+//   - providers can be bulk-enumerated and reconciled against reality via
+//     Instances, so a crashed worker's leaked VMs can be garbage collected
+//   - Stop gives a single place to cancel in-flight work and wait for
+//     outstanding cloud API calls before the process exits
+type InstanceSet interface {
+	Create(startAttributes *StartAttributes) (Instance, error)
+	CreateWithProgress(startAttributes *StartAttributes, progresser Progresser) (Instance, error)
+
+	// Instances bulk-enumerates every instance this set's credentials can
+	// see, regardless of whether this process created it. This lets a
+	// caller reconcile against reality rather than relying on in-memory
+	// bookkeeping that a crash would lose.
+	Instances() ([]Instance, error)
+
+	SupportsProgress() bool
+
+	// Stop cancels the set's background context and waits for outstanding
+	// cloud API calls to finish before returning.
+	Stop()
+}
+
+// OrphanReaper is implemented by InstanceSets that can clean up resources a
+// crashed worker process left behind (a VM or SSH key with nothing left
+// tracking it). Callers should invoke ReapOrphans once at startup, before
+// the set has created any instances of its own: at that point, anything
+// Instances sees must belong to a previous process rather than a warm
+// instance or in-flight job this one is responsible for.
+type OrphanReaper interface {
+	ReapOrphans() error
+}
+
+// InstanceSetFactory constructs an InstanceSet from provider config. Backend
+// packages register one via Register in an init function.
+type InstanceSetFactory func(cfg *config.ProviderConfig) (InstanceSet, error)
+
+var (
+	instanceSetFactories          = map[string]InstanceSetFactory{}
+	instanceSetEnvironmentVars    = map[string]map[string]string{}
+	instanceSetHumanReadableNames = map[string]string{}
+)
+
+// Register makes an InstanceSet factory available under name, for use by
+// NewInstanceSet. humanReadableName and envVars are used when generating
+// operator-facing documentation of provider configuration.
+func Register(name, humanReadableName string, envVars map[string]string, factory InstanceSetFactory) {
+	instanceSetFactories[name] = factory
+	instanceSetHumanReadableNames[name] = humanReadableName
+	instanceSetEnvironmentVars[name] = envVars
+}
+
+// NewInstanceSet builds the InstanceSet registered under name.
+func NewInstanceSet(name string, cfg *config.ProviderConfig) (InstanceSet, error) {
+	factory, ok := instanceSetFactories[name]
+	if !ok {
+		return nil, fmt.Errorf("backend: unknown provider %q", name)
+	}
+	return factory(cfg)
+}
@@ -0,0 +1,282 @@
+package backend
+
+import (
+	goctx "context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/travis-ci/worker/context"
+)
+
+const (
+	defaultInstancePoolSize        = 2
+	defaultInstancePoolMaxAge      = time.Hour
+	defaultInstancePoolStopTimeout = time.Minute
+
+	// instancePoolSweepInterval is how often the background reaper checks
+	// bucket.ready for instances past maxAge, so a bucket whose traffic dries
+	// up doesn't keep billing for warm VMs until someone happens to request
+	// that exact StartAttributes again.
+	instancePoolSweepInterval = time.Minute
+)
+
+// InstancePool wraps an InstanceSet and keeps a small number of
+// pre-provisioned instances warm per StartAttributes bucket, so that
+// Create/CreateWithProgress can skip the cold-start path (cloud API call +
+// SSH wait, which the VPC backend's retry constants show can run well over
+// a minute) on the common case. It implements InstanceSet itself, so it can
+// be used in place of the set it wraps.
+type InstancePool struct {
+	set    InstanceSet
+	size   int
+	maxAge time.Duration
+
+	mu      sync.Mutex
+	buckets map[string]*instancePoolBucket
+	stopped bool
+
+	ctx    goctx.Context
+	cancel goctx.CancelFunc
+}
+
+type instancePoolBucket struct {
+	startAttributes *StartAttributes
+	ready           []*pooledInstance
+	filling         int
+}
+
+type pooledInstance struct {
+	instance Instance
+	created  time.Time
+}
+
+// NewInstancePool wraps set with a pool that keeps up to size instances
+// warm per StartAttributes bucket, discarding any that sit around longer
+// than maxAge. A background goroutine sweeps for aged-out instances every
+// instancePoolSweepInterval, so an idle bucket doesn't bill for warm VMs
+// indefinitely; Stop shuts that goroutine down along with everything else.
+func NewInstancePool(set InstanceSet, size int, maxAge time.Duration) *InstancePool {
+	if size <= 0 {
+		size = defaultInstancePoolSize
+	}
+	if maxAge <= 0 {
+		maxAge = defaultInstancePoolMaxAge
+	}
+	ctx, cancel := goctx.WithCancel(goctx.Background())
+	ip := &InstancePool{
+		set:     set,
+		size:    size,
+		maxAge:  maxAge,
+		buckets: map[string]*instancePoolBucket{},
+		ctx:     ctx,
+		cancel:  cancel,
+	}
+	go ip.sweepLoop()
+	return ip
+}
+
+// sweepLoop periodically stops every bucket's aged-out warm instances until
+// the pool is stopped.
+func (ip *InstancePool) sweepLoop() {
+	ticker := time.NewTicker(instancePoolSweepInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ip.ctx.Done():
+			return
+		case <-ticker.C:
+			ip.sweepAged()
+		}
+	}
+}
+
+// sweepAged stops and drops every warm instance that's past maxAge,
+// regardless of whether anything has asked for its bucket recently.
+func (ip *InstancePool) sweepAged() {
+	ip.mu.Lock()
+	var aged []Instance
+	for _, bucket := range ip.buckets {
+		kept := bucket.ready[:0]
+		for _, pooled := range bucket.ready {
+			if time.Since(pooled.created) > ip.maxAge {
+				aged = append(aged, pooled.instance)
+			} else {
+				kept = append(kept, pooled)
+			}
+		}
+		bucket.ready = kept
+	}
+	ip.mu.Unlock()
+
+	for _, instance := range aged {
+		go ip.stop(instance)
+	}
+}
+
+func (ip *InstancePool) Create(startAttributes *StartAttributes) (Instance, error) {
+	if instance := ip.takeWarm(startAttributes); instance != nil {
+		return instance, nil
+	}
+	return ip.set.Create(startAttributes)
+}
+
+func (ip *InstancePool) CreateWithProgress(startAttributes *StartAttributes, progresser Progresser) (Instance, error) {
+	if instance := ip.takeWarm(startAttributes); instance != nil {
+		return instance, nil
+	}
+	return ip.set.CreateWithProgress(startAttributes, progresser)
+}
+
+func (ip *InstancePool) Instances() ([]Instance, error) {
+	return ip.set.Instances()
+}
+
+func (ip *InstancePool) SupportsProgress() bool {
+	return ip.set.SupportsProgress()
+}
+
+// Stop stops every idle warm instance sitting in the pool, then stops the
+// wrapped set. Instances currently on loan to a job are the job's
+// responsibility to Stop when it's done with them, same as always.
+//
+// Setting stopped before sweeping bucket.ready closes a race with refill:
+// once stopped is set, a fill that's still in flight stops the instance it
+// just created instead of appending it to a bucket nothing will ever sweep
+// again.
+func (ip *InstancePool) Stop() {
+	ip.cancel()
+
+	ip.mu.Lock()
+	ip.stopped = true
+	var idle []Instance
+	for _, bucket := range ip.buckets {
+		for _, pooled := range bucket.ready {
+			idle = append(idle, pooled.instance)
+		}
+		bucket.ready = nil
+	}
+	ip.mu.Unlock()
+
+	wg := sync.WaitGroup{}
+	for _, instance := range idle {
+		wg.Add(1)
+		go func(instance Instance) {
+			defer wg.Done()
+			ip.stop(instance)
+		}(instance)
+	}
+	wg.Wait()
+
+	ip.set.Stop()
+}
+
+// takeWarm pops a ready instance for startAttributes if one is available and
+// not past its max lifetime, and kicks off a background refill regardless.
+// It returns nil if the caller should fall back to a cold start.
+func (ip *InstancePool) takeWarm(startAttributes *StartAttributes) Instance {
+	key := instancePoolKey(startAttributes)
+
+	ip.mu.Lock()
+	if ip.stopped {
+		ip.mu.Unlock()
+		return nil
+	}
+	bucket := ip.bucketLocked(key, startAttributes)
+	var pooled *pooledInstance
+	if len(bucket.ready) > 0 {
+		pooled = bucket.ready[0]
+		bucket.ready = bucket.ready[1:]
+	}
+	ip.mu.Unlock()
+
+	go ip.refill(key, startAttributes)
+
+	if pooled == nil {
+		return nil
+	}
+	if time.Since(pooled.created) > ip.maxAge {
+		go ip.stop(pooled.instance)
+		return nil
+	}
+
+	if vi, ok := pooled.instance.(*vpcInstance); ok {
+		vi.warmed = true
+	}
+	return pooled.instance
+}
+
+// refill tops a bucket back up to ip.size, cold-starting instances in the
+// background so callers never block on a refill.
+func (ip *InstancePool) refill(key string, startAttributes *StartAttributes) {
+	ip.mu.Lock()
+	if ip.stopped {
+		ip.mu.Unlock()
+		return
+	}
+	bucket := ip.bucketLocked(key, startAttributes)
+	need := ip.size - len(bucket.ready) - bucket.filling
+	if need <= 0 {
+		ip.mu.Unlock()
+		return
+	}
+	bucket.filling += need
+	ip.mu.Unlock()
+
+	for n := 0; n < need; n++ {
+		go func() {
+			defer func() {
+				ip.mu.Lock()
+				bucket.filling--
+				ip.mu.Unlock()
+			}()
+
+			logger := context.LoggerFromContext(goctx.Background()).WithField("self", "backend/instance-pool")
+
+			instance, err := ip.set.Create(startAttributes)
+			if err != nil {
+				logger.WithError(err).WithField("bucket", key).Warn("failed to warm instance")
+				return
+			}
+
+			ip.mu.Lock()
+			if ip.stopped {
+				ip.mu.Unlock()
+				// Stop already swept bucket.ready before this fill finished;
+				// nothing will ever sweep this instance again, so stop it
+				// ourselves instead of leaking a warm VM.
+				ip.stop(instance)
+				return
+			}
+			bucket.ready = append(bucket.ready, &pooledInstance{instance: instance, created: time.Now()})
+			ip.mu.Unlock()
+		}()
+	}
+}
+
+func (ip *InstancePool) bucketLocked(key string, startAttributes *StartAttributes) *instancePoolBucket {
+	bucket, ok := ip.buckets[key]
+	if !ok {
+		bucket = &instancePoolBucket{startAttributes: startAttributes}
+		ip.buckets[key] = bucket
+	}
+	return bucket
+}
+
+func (ip *InstancePool) stop(instance Instance) {
+	ctx, cancel := goctx.WithTimeout(goctx.Background(), defaultInstancePoolStopTimeout)
+	defer cancel()
+	if err := instance.Stop(ctx); err != nil {
+		context.LoggerFromContext(ctx).WithError(err).WithField("self", "backend/instance-pool").Warn("failed to stop idle warm instance")
+	}
+}
+
+// instancePoolKey buckets warm instances by their requested StartAttributes,
+// so e.g. a warm VM pooled for one ImageName never gets handed out for a job
+// that asked for a different ImageName.
+func instancePoolKey(startAttributes *StartAttributes) string {
+	if startAttributes == nil {
+		return ""
+	}
+	return fmt.Sprintf("%+v", *startAttributes)
+}
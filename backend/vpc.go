@@ -6,18 +6,24 @@ import (
 	"crypto/rand"
 	"crypto/rsa"
 	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"io"
 	mathrand "math/rand"
+	"mime/multipart"
 	"net/http"
+	"net/textproto"
 	"strconv"
 	"strings"
+	"sync"
 	"text/template"
 	"time"
 
 	"github.com/IBM/go-sdk-core/v5/core"
 	"github.com/IBM/vpc-go-sdk/vpcv1"
 	"github.com/pkg/errors"
+	metrics "github.com/rcrowley/go-metrics"
 	"github.com/sirupsen/logrus"
 	"github.com/travis-ci/worker/config"
 	"github.com/travis-ci/worker/context"
@@ -34,6 +40,27 @@ const (
 	defaultVPCAPIRetryInterval = time.Second * 5
 	defaultVPCSSHRetries       = 60
 	defaultVPCSSHRetryInterval = time.Second * 2
+
+	vpcSSHDialTimeout = time.Second * 10
+	vpcScriptPath     = "~travis/build.sh"
+	vpcTraceFilePath  = "~travis/build.sh.trace"
+
+	// vpcInstanceNamePrefix is applied to every instance and SSH key this
+	// package creates, so that Instances and ReapOrphanedKeys can tell ours
+	// apart from anything else living in the resource group.
+	vpcInstanceNamePrefix = "travis-"
+
+	// defaultVPCProgressFormat reports progress messages as plain,
+	// human-readable text. vpcProgressFormatJSON reports them as a JSON
+	// object instead, for downstream log processors that want to chart
+	// cold-start latency without scraping text.
+	defaultVPCProgressFormat = "text"
+	vpcProgressFormatJSON    = "json"
+
+	// defaultVPCZoneFailureCooldown is how long a zone is skipped for new
+	// instances after a capacity/quota failure, so a transient regional
+	// shortage doesn't keep failing jobs against the same zone.
+	defaultVPCZoneFailureCooldown = time.Minute * 5
 )
 
 var (
@@ -50,73 +77,134 @@ var (
 	}
 
 	vpcEnvironmentVariables = map[string]string{
-		"IC_API_KEY":         "[REQUIRED] API key with access to create VMs (required)",
-		"REGION":             "region where everything goes",
-		"INSTANCE_PROFILE":   "type of instance for each build",
-		"RESOURCE_GROUP_ID":  "[REQUIRED] ID of the resource group to add VMs to",
-		"VPC_ID":             "[REQUIRED] ID of the VPC instance to attach VMs to",
-		"DEFAULT_IMAGE_ID":   "ID of the default image to boot VMs into",
-		"SUBNET_IDS":         "[REQUIRED] list of subnet IDs to spawn VMs into",
-		"SECURITY_GROUP_IDS": "list of security group IDs to attach to VMs",
-		"USER_DATA":          "base64 encoded custom user data",
-		"USERNAME":           "username to SSH into VM with",
-		"API_RETRIES":        "number of times to retry API",
-		"API_RETRY_INTERVAL": "how long to wait in between API retries",
-		"SSH_RETRIES":        "number of times to retry SSH into instance",
-		"SSH_RETRY_INTERVAL": "how long to wait in between API retries",
-	}
-
-	vpcStartupScript = template.Must(template.New("vpc-startup").Parse(`#!/usr/bin/env bash
-cat > ~travis/.ssh/authorized_keys <<EOF
-{{ .PublicKey }}
-EOF
-chown -R travis:travis ~travis/.ssh/
-
-{{ .UserData }}
+		"IC_API_KEY":            "[REQUIRED] API key with access to create VMs (required)",
+		"REGION":                "region where everything goes",
+		"INSTANCE_PROFILE":      "type of instance for each build",
+		"RESOURCE_GROUP_ID":     "[REQUIRED] ID of the resource group to add VMs to",
+		"VPC_ID":                "[REQUIRED] ID of the VPC instance to attach VMs to",
+		"DEFAULT_IMAGE_ID":      "ID of the default image to boot VMs into",
+		"SUBNET_IDS":            "[REQUIRED] list of subnet IDs to spawn VMs into",
+		"SECURITY_GROUP_IDS":    "list of security group IDs to attach to VMs",
+		"USER_DATA":             "base64 encoded custom user data, run as a cloud-init x-shellscript part",
+		"CLOUD_INIT_EXTRA_YAML": "base64 encoded cloud-config YAML, appended to the generated #cloud-config part (packages, write_files, runcmd, etc.)",
+		"CLOUD_INIT_MIME_PARTS": "extra raw cloud-init MIME parts to append, as ';' separated '<content-type>,<base64-body>' entries",
+		"USERNAME":              "username to SSH into VM with",
+		"PROGRESS_FORMAT":       "format for instance startup progress events sent to a Progresser: 'text' (default) or 'json'",
+		"ZONE_FAILURE_COOLDOWN": "how long to avoid a zone after a capacity/quota failure there, e.g. '5m'",
+		"API_RETRIES":           "number of times to retry API",
+		"API_RETRY_INTERVAL":    "how long to wait in between API retries",
+		"SSH_RETRIES":           "number of times to retry SSH into instance",
+		"SSH_RETRY_INTERVAL":    "how long to wait in between SSH retries (also between instance readiness probes)",
+	}
+
+	vpcCloudConfigTemplate = template.Must(template.New("vpc-cloud-config").Parse(`#cloud-config
+users:
+  - name: travis
+    lock_passwd: true
+    ssh_authorized_keys:
+      - {{ .PublicKey }}
 `))
 )
 
 func init() {
-	Register("vpc", "IBM Cloud Virtual Servers for VPC", vpcEnvironmentVariables, newVPCProvider)
-}
-
-type vpcProvider struct {
-	cfg              *config.ProviderConfig
-	service          *vpcv1.VpcV1
-	instanceProfile  string
-	defaultImageID   string
-	resourceGroupID  string
-	vpcID            string
-	subnetIDs        []string
-	securityGroupIDs []string
-	region           string
-	userData         string
-	username         string
-	apiRetries       int
-	apiRetryInterval time.Duration
-	sshRetries       int
-	sshRetryInterval time.Duration
+	Register("vpc", "IBM Cloud Virtual Servers for VPC", vpcEnvironmentVariables, newVPCInstanceSet)
+}
+
+// vpcInstanceSet is one IBM Cloud VPC provider config's worth of credentials
+// and defaults. It owns a cancellable background context that all of its
+// cloud API calls run against, so that Stop can cancel in-flight work and
+// wait for it to unwind without every call needing its own context plumbed
+// in from outside.
+type vpcInstanceSet struct {
+	cfg                 *config.ProviderConfig
+	service             *vpcv1.VpcV1
+	instanceProfile     string
+	defaultImageID      string
+	resourceGroupID     string
+	vpcID               string
+	subnetIDs           []string
+	securityGroupIDs    []string
+	region              string
+	userData            string
+	cloudInitExtraYAML  string
+	cloudInitExtraParts []vpcCloudInitPart
+	username            string
+	progressFormat      string
+	zoneFailureCooldown time.Duration
+	apiRetries          int
+	apiRetryInterval    time.Duration
+	sshRetries          int
+	sshRetryInterval    time.Duration
+
+	subnetZonesMu sync.Mutex
+	subnetZones   map[string]string // subnet ID -> zone name, resolved lazily
+
+	zoneHealthMu sync.Mutex
+	zoneHealth   map[string]*vpcZoneHealth // zone name -> recent CreateInstance outcomes
+
+	// workerID uniquely identifies this process's instance set, and is
+	// embedded in every instance/key name it creates, so a future process
+	// can tell its own resources apart from ones left behind by a worker
+	// that crashed mid-Create.
+	workerID string
+
+	ctx    goctx.Context
+	cancel goctx.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// vpcCloudInitPart is a raw, operator-supplied cloud-init MIME part appended
+// to the multipart user-data document.
+type vpcCloudInitPart struct {
+	contentType string
+	body        []byte
+}
+
+// vpcZoneHealth tracks recent CreateInstance outcomes for a single
+// availability zone, so selectSubnet can steer new instances away from a
+// zone that just rejected one for lack of capacity.
+type vpcZoneHealth struct {
+	successCount        int
+	recentFailureCount  int
+	lastFailureTime     time.Time
+	lastFailureCapacity bool
 }
 
 type vpcInstance struct {
-	provider    *vpcProvider
+	instanceSet *vpcInstanceSet
 	instance    *vpcv1.Instance
 	sshDialer   ssh.Dialer
 	sshKey      *vpcv1.Key
 	startupTime time.Duration
+	// warmed is set by InstancePool when this instance is handed out from
+	// the warm pool instead of being cold-started for the caller.
+	warmed bool
 }
 
-func newVPCProvider(cfg *config.ProviderConfig) (Provider, error) {
-	ret := &vpcProvider{
-		cfg:              cfg,
-		region:           defaultVPCRegion,
-		instanceProfile:  defaultVPCInstanceProfile,
-		defaultImageID:   defaultVPCImageID,
-		username:         defaultVPCInstanceUsername,
-		apiRetries:       defaultVPCAPIRetries,
-		apiRetryInterval: defaultVPCAPIRetryInterval,
-		sshRetries:       defaultVPCSSHRetries,
-		sshRetryInterval: defaultVPCSSHRetryInterval,
+func newVPCInstanceSet(cfg *config.ProviderConfig) (InstanceSet, error) {
+	workerIDBytes := make([]byte, 8)
+	if _, err := rand.Read(workerIDBytes); err != nil {
+		return nil, fmt.Errorf("failed to generate worker id: %w", err)
+	}
+
+	ctx, cancel := goctx.WithCancel(goctx.Background())
+	ret := &vpcInstanceSet{
+		cfg:                 cfg,
+		workerID:            hex.EncodeToString(workerIDBytes),
+		ctx:                 ctx,
+		cancel:              cancel,
+		region:              defaultVPCRegion,
+		instanceProfile:     defaultVPCInstanceProfile,
+		defaultImageID:      defaultVPCImageID,
+		username:            defaultVPCInstanceUsername,
+		progressFormat:      defaultVPCProgressFormat,
+		zoneFailureCooldown: defaultVPCZoneFailureCooldown,
+		apiRetries:          defaultVPCAPIRetries,
+		apiRetryInterval:    defaultVPCAPIRetryInterval,
+		sshRetries:          defaultVPCSSHRetries,
+		sshRetryInterval:    defaultVPCSSHRetryInterval,
+		subnetZones:         map[string]string{},
+		zoneHealth:          map[string]*vpcZoneHealth{},
 	}
 	if cfg.IsSet("REGION") {
 		ret.region = cfg.Get("REGION")
@@ -147,9 +235,36 @@ func newVPCProvider(cfg *config.ProviderConfig) (Provider, error) {
 		}
 		ret.userData = string(userDataBytes)
 	}
+	if cfg.IsSet("CLOUD_INIT_EXTRA_YAML") {
+		extraYAMLBytes, err := base64.RawURLEncoding.DecodeString(cfg.Get("CLOUD_INIT_EXTRA_YAML"))
+		if err != nil {
+			return nil, err
+		}
+		ret.cloudInitExtraYAML = string(extraYAMLBytes)
+	}
+	if cfg.IsSet("CLOUD_INIT_MIME_PARTS") {
+		parts, err := parseCloudInitMIMEParts(cfg.Get("CLOUD_INIT_MIME_PARTS"))
+		if err != nil {
+			return nil, err
+		}
+		ret.cloudInitExtraParts = parts
+	}
 	if cfg.IsSet("USERNAME") {
 		ret.username = cfg.Get("USERNAME")
 	}
+	if cfg.IsSet("PROGRESS_FORMAT") {
+		ret.progressFormat = cfg.Get("PROGRESS_FORMAT")
+		if ret.progressFormat != defaultVPCProgressFormat && ret.progressFormat != vpcProgressFormatJSON {
+			return nil, fmt.Errorf("unknown PROGRESS_FORMAT %q", ret.progressFormat)
+		}
+	}
+	if cfg.IsSet("ZONE_FAILURE_COOLDOWN") {
+		t, err := time.ParseDuration(cfg.Get("ZONE_FAILURE_COOLDOWN"))
+		if err != nil {
+			return nil, err
+		}
+		ret.zoneFailureCooldown = t
+	}
 	if cfg.IsSet("API_RETRIES") {
 		c, err := strconv.ParseInt(cfg.Get("API_RETRIES"), 0, 32)
 		if err != nil {
@@ -198,31 +313,42 @@ func newVPCProvider(cfg *config.ProviderConfig) (Provider, error) {
 	return ret, nil
 }
 
-func (p *vpcProvider) Start(ctx goctx.Context, _ *StartAttributes) (i Instance, retErr error) {
+func (is *vpcInstanceSet) Create(startAttributes *StartAttributes) (Instance, error) {
+	return is.create(startAttributes, nil)
+}
+
+func (is *vpcInstanceSet) create(_ *StartAttributes, progresser Progresser) (i Instance, retErr error) {
+	is.wg.Add(1)
+	defer is.wg.Done()
+	ctx := is.ctx
+
 	begin := time.Now()
 	logger := context.LoggerFromContext(ctx).WithField("self", "backend/vpc")
+	progress := newVPCProgressReporter(progresser, is.progressFormat, begin)
 
-	key, sshDialer, err := p.createSSHKey(ctx)
+	key, sshDialer, err := is.createSSHKey(ctx)
 	if err != nil {
 		return nil, err
 	}
+	progress.stage("SSH key created")
 	defer func() {
 		if retErr != nil {
-			if err := p.retryDeleteSSHKey(ctx, key); err != nil {
+			if err := is.retryDeleteSSHKey(ctx, key); err != nil {
 				logger.WithError(err).Error("failed to delete SSH key")
 			}
 		}
 	}()
 
-	instance, err := p.createInstance(ctx, key)
+	instance, err := is.createInstance(ctx, key)
 	if err != nil {
 		return nil, err
 	}
+	progress.stage("instance create accepted")
 	defer func() {
 		if retErr != nil {
 			logger := logger.WithField("instance", instance.Name)
 			logger.Info("cleaning up instance due to failure")
-			if _, err := p.service.DeleteInstanceWithContext(ctx, &vpcv1.DeleteInstanceOptions{ID: instance.ID}); err != nil {
+			if _, err := is.service.DeleteInstanceWithContext(ctx, &vpcv1.DeleteInstanceOptions{ID: instance.ID}); err != nil {
 				logger.WithError(err).Error("failed to cleanup instance")
 				return
 			}
@@ -230,14 +356,14 @@ func (p *vpcProvider) Start(ctx goctx.Context, _ *StartAttributes) (i Instance,
 		}
 	}()
 
-	newInstance, err := p.waitForInstance(ctx, instance, sshDialer)
+	newInstance, err := is.waitForInstance(ctx, instance, sshDialer, progress)
 	if err != nil {
 		return nil, err
 	}
 	end := time.Now()
 
 	return &vpcInstance{
-		provider:    p,
+		instanceSet: is,
 		instance:    newInstance,
 		sshDialer:   sshDialer,
 		sshKey:      key,
@@ -245,7 +371,7 @@ func (p *vpcProvider) Start(ctx goctx.Context, _ *StartAttributes) (i Instance,
 	}, nil
 }
 
-func (p *vpcProvider) createSSHKey(ctx goctx.Context) (*vpcv1.Key, *ssh.AuthDialer, error) {
+func (is *vpcInstanceSet) createSSHKey(ctx goctx.Context) (*vpcv1.Key, *ssh.AuthDialer, error) {
 	logger := context.LoggerFromContext(ctx).WithField("self", "backend/vpc")
 
 	privateKey, err := rsa.GenerateKey(rand.Reader, 4096)
@@ -261,12 +387,18 @@ func (p *vpcProvider) createSSHKey(ctx goctx.Context) (*vpcv1.Key, *ssh.AuthDial
 		return nil, nil, err
 	}
 
+	name, err := is.generateName()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to generate ssh key name: %w", err)
+	}
+
 	sshKeyOptions := &vpcv1.CreateKeyOptions{
-		ResourceGroup: &vpcv1.ResourceGroupIdentityByID{ID: &p.resourceGroupID},
+		Name:          &name,
+		ResourceGroup: &vpcv1.ResourceGroupIdentityByID{ID: &is.resourceGroupID},
 	}
 	sshKeyOptions.SetPublicKey(string(publicKey))
 	logger.WithField("key", sshKeyOptions.Name).Debug("creating ssh key")
-	key, _, err := p.service.CreateKeyWithContext(ctx, sshKeyOptions)
+	key, _, err := is.service.CreateKeyWithContext(ctx, sshKeyOptions)
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to add ssh key to ibm cloud %w", err)
 	}
@@ -274,16 +406,23 @@ func (p *vpcProvider) createSSHKey(ctx goctx.Context) (*vpcv1.Key, *ssh.AuthDial
 	return key, sshDialer, nil
 }
 
-func (p *vpcProvider) createInstance(ctx goctx.Context, key *vpcv1.Key) (*vpcv1.Instance, error) {
+func (is *vpcInstanceSet) createInstance(ctx goctx.Context, key *vpcv1.Key) (*vpcv1.Instance, error) {
 	logger := context.LoggerFromContext(ctx).WithField("self", "backend/vpc")
-	instancePrototype, err := p.getInstancePrototype(ctx, key)
+
+	subnetID, zone, err := is.selectSubnet(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	instancePrototype, err := is.getInstancePrototype(ctx, key, subnetID, zone)
 	if err != nil {
 		return nil, err
 	}
 	logger.WithField("instance", instancePrototype.Name).Debug("creating vpc instance")
-	instance, _, err := p.service.CreateInstanceWithContext(ctx, &vpcv1.CreateInstanceOptions{
+	instance, _, err := is.service.CreateInstanceWithContext(ctx, &vpcv1.CreateInstanceOptions{
 		InstancePrototype: instancePrototype,
 	})
+	is.recordZoneOutcome(zone, err)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create vpc instane: %w", err)
 	}
@@ -291,48 +430,196 @@ func (p *vpcProvider) createInstance(ctx goctx.Context, key *vpcv1.Key) (*vpcv1.
 	return instance, err
 }
 
-func (p *vpcProvider) getInstancePrototype(ctx goctx.Context, key *vpcv1.Key) (*vpcv1.InstancePrototypeInstanceByImage, error) {
+// selectSubnet picks the subnet to launch into, and returns the zone it
+// belongs to. Zones that most recently failed CreateInstance with a
+// capacity/quota error are skipped for zoneFailureCooldown; among the
+// remaining zones, subnets are weighted towards those with fewer recent
+// failures. If every zone is cooling down, it falls back to the
+// least-recently-failed one rather than erroring outright.
+func (is *vpcInstanceSet) selectSubnet(ctx goctx.Context) (string, string, error) {
 	logger := context.LoggerFromContext(ctx).WithField("self", "backend/vpc")
 
-	// Choose random subnet to balance VMs. Ideally multiple subnets are given that
-	// are spread out across availability zones.
-	subnetID := p.subnetIDs[mathrand.Int()%len(p.subnetIDs)]
+	type candidate struct {
+		subnetID string
+		zone     string
+		health   vpcZoneHealthSnapshot
+	}
+
+	candidates := make([]candidate, 0, len(is.subnetIDs))
+	for _, subnetID := range is.subnetIDs {
+		zone, err := is.subnetZone(ctx, subnetID)
+		if err != nil {
+			return "", "", err
+		}
+		candidates = append(candidates, candidate{subnetID: subnetID, zone: zone, health: is.zoneHealthSnapshot(zone)})
+	}
+
+	now := time.Now()
+	var healthy []candidate
+	for _, c := range candidates {
+		if c.health.lastFailureCapacity && now.Sub(c.health.lastFailureTime) < is.zoneFailureCooldown {
+			continue
+		}
+		healthy = append(healthy, c)
+	}
+
+	if len(healthy) == 0 {
+		logger.Warn("every zone is cooling down from a capacity failure, falling back to the least-recently-failed zone")
+		oldest := candidates[0]
+		for _, c := range candidates[1:] {
+			if c.health.lastFailureTime.Before(oldest.health.lastFailureTime) {
+				oldest = c
+			}
+		}
+		return oldest.subnetID, oldest.zone, nil
+	}
 
-	// Get the zone from the subnet, because this SDK requires we specify zone even
-	// if it can be inferred by subnet.
+	totalWeight := 0
+	weights := make([]int, len(healthy))
+	for idx, c := range healthy {
+		// recentFailureCount only resets on a successful CreateInstance, so a
+		// zone failing for a non-capacity reason (bad image ID, expired
+		// credentials, etc.) never gets excluded and its weight would
+		// otherwise decay to 0, which mathrand.Intn can't take as totalWeight.
+		// Floor it at 1 so such a zone is still picked, just rarely.
+		weight := 1000 / (c.health.recentFailureCount + 1)
+		if weight < 1 {
+			weight = 1
+		}
+		weights[idx] = weight
+		totalWeight += weight
+	}
+	pick := mathrand.Intn(totalWeight)
+	for idx, weight := range weights {
+		if pick < weight {
+			return healthy[idx].subnetID, healthy[idx].zone, nil
+		}
+		pick -= weight
+	}
+	last := healthy[len(healthy)-1]
+	return last.subnetID, last.zone, nil
+}
+
+// subnetZone returns the availability zone a subnet lives in, consulting the
+// IBM Cloud API only the first time a given subnet is seen.
+func (is *vpcInstanceSet) subnetZone(ctx goctx.Context, subnetID string) (string, error) {
+	is.subnetZonesMu.Lock()
+	zone, ok := is.subnetZones[subnetID]
+	is.subnetZonesMu.Unlock()
+	if ok {
+		return zone, nil
+	}
+
+	logger := context.LoggerFromContext(ctx).WithField("self", "backend/vpc")
 	logger.WithField("id", subnetID).Debug("getting subnet details")
-	subnet, _, err := p.service.GetSubnetWithContext(ctx, p.service.NewGetSubnetOptions(subnetID))
+	subnet, _, err := is.service.GetSubnetWithContext(ctx, is.service.NewGetSubnetOptions(subnetID))
 	if err != nil {
-		return nil, fmt.Errorf("failed to get subnet details: %w", err)
+		return "", fmt.Errorf("failed to get subnet details: %w", err)
 	}
 	logger.WithField("subnet", subnet).Debug("got subnet details")
 
-	// TODO: check if the availability zone is ready, and choose another subnet if not.
+	is.subnetZonesMu.Lock()
+	is.subnetZones[subnetID] = *subnet.Zone.Name
+	is.subnetZonesMu.Unlock()
+	return *subnet.Zone.Name, nil
+}
+
+func (is *vpcInstanceSet) getZoneHealth(zone string) *vpcZoneHealth {
+	is.zoneHealthMu.Lock()
+	defer is.zoneHealthMu.Unlock()
+	health, ok := is.zoneHealth[zone]
+	if !ok {
+		health = &vpcZoneHealth{}
+		is.zoneHealth[zone] = health
+	}
+	return health
+}
 
-	userDataBuffer := bytes.Buffer{}
-	if err := vpcStartupScript.Execute(&userDataBuffer, struct{ PublicKey, UserData string }{
-		PublicKey: *key.PublicKey,
-		UserData:  p.userData,
-	}); err != nil {
+// vpcZoneHealthSnapshot is a point-in-time copy of a vpcZoneHealth, taken
+// under zoneHealthMu, so callers like selectSubnet can read it without
+// racing recordZoneOutcome's concurrent writes to the shared *vpcZoneHealth.
+type vpcZoneHealthSnapshot struct {
+	recentFailureCount  int
+	lastFailureTime     time.Time
+	lastFailureCapacity bool
+}
+
+func (is *vpcInstanceSet) zoneHealthSnapshot(zone string) vpcZoneHealthSnapshot {
+	health := is.getZoneHealth(zone)
+	is.zoneHealthMu.Lock()
+	defer is.zoneHealthMu.Unlock()
+	return vpcZoneHealthSnapshot{
+		recentFailureCount:  health.recentFailureCount,
+		lastFailureTime:     health.lastFailureTime,
+		lastFailureCapacity: health.lastFailureCapacity,
+	}
+}
+
+// recordZoneOutcome updates zone health bookkeeping and the per-zone
+// create success/failure counters in metrics.DefaultRegistry after a
+// CreateInstance call.
+func (is *vpcInstanceSet) recordZoneOutcome(zone string, createErr error) {
+	health := is.getZoneHealth(zone)
+
+	is.zoneHealthMu.Lock()
+	if createErr == nil {
+		health.successCount++
+		health.recentFailureCount = 0
+	} else {
+		health.recentFailureCount++
+		health.lastFailureTime = time.Now()
+		health.lastFailureCapacity = isVPCCapacityError(createErr)
+	}
+	is.zoneHealthMu.Unlock()
+
+	if createErr == nil {
+		metrics.GetOrRegisterCounter(fmt.Sprintf("vpc.zone.%s.create.success", zone), metrics.DefaultRegistry).Inc(1)
+	} else {
+		metrics.GetOrRegisterCounter(fmt.Sprintf("vpc.zone.%s.create.failure", zone), metrics.DefaultRegistry).Inc(1)
+	}
+}
+
+// isVPCCapacityError reports whether err looks like an IBM Cloud capacity or
+// quota rejection, as opposed to some other instance creation failure (bad
+// image ID, malformed request, etc.) that retrying against a different zone
+// wouldn't fix.
+func isVPCCapacityError(err error) bool {
+	msg := strings.ToLower(err.Error())
+	for _, substr := range []string{"capacity", "quota", "insufficient", "over_quota", "out_of_capacity"} {
+		if strings.Contains(msg, substr) {
+			return true
+		}
+	}
+	return false
+}
+
+func (is *vpcInstanceSet) getInstancePrototype(ctx goctx.Context, key *vpcv1.Key, subnetID, zone string) (*vpcv1.InstancePrototypeInstanceByImage, error) {
+	userData, err := is.renderUserData(key)
+	if err != nil {
 		return nil, fmt.Errorf("failed to render user data: %w", err)
 	}
-	userData := userDataBuffer.String()
+
+	name, err := is.generateName()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate instance name: %w", err)
+	}
 
 	instancePrototype := &vpcv1.InstancePrototypeInstanceByImage{
+		Name:          &name,
 		Keys:          []vpcv1.KeyIdentityIntf{&vpcv1.KeyIdentityByID{ID: key.ID}},
-		Profile:       &vpcv1.InstanceProfileIdentityByName{Name: &p.instanceProfile},
-		ResourceGroup: &vpcv1.ResourceGroupIdentityByID{ID: &p.resourceGroupID},
+		Profile:       &vpcv1.InstanceProfileIdentityByName{Name: &is.instanceProfile},
+		ResourceGroup: &vpcv1.ResourceGroupIdentityByID{ID: &is.resourceGroupID},
 		UserData:      &userData,
-		VPC:           &vpcv1.VPCIdentityByID{ID: &p.vpcID},
-		Image:         &vpcv1.ImageIdentityByID{ID: &p.defaultImageID},
+		VPC:           &vpcv1.VPCIdentityByID{ID: &is.vpcID},
+		Image:         &vpcv1.ImageIdentityByID{ID: &is.defaultImageID},
 		PrimaryNetworkInterface: &vpcv1.NetworkInterfacePrototype{
 			SecurityGroups: []vpcv1.SecurityGroupIdentityIntf{},
 			Subnet:         &vpcv1.SubnetIdentityByID{ID: &subnetID},
 		},
-		Zone: &vpcv1.ZoneIdentityByName{Name: subnet.Zone.Name},
+		Zone: &vpcv1.ZoneIdentityByName{Name: &zone},
 	}
 
-	for _, secgroup := range p.securityGroupIDs {
+	for _, secgroup := range is.securityGroupIDs {
 		secgroup := secgroup
 		instancePrototype.PrimaryNetworkInterface.SecurityGroups = append(
 			instancePrototype.PrimaryNetworkInterface.SecurityGroups,
@@ -342,9 +629,91 @@ func (p *vpcProvider) getInstancePrototype(ctx goctx.Context, key *vpcv1.Key) (*
 	return instancePrototype, nil
 }
 
+// renderUserData builds a multipart cloud-init MIME document: a #cloud-config
+// part declaring the travis user's SSH key (plus any operator-supplied extra
+// YAML), an x-shellscript part carrying the operator-supplied USER_DATA, and
+// any raw parts from CLOUD_INIT_MIME_PARTS. This lets unmodified upstream
+// cloud images (e.g. Ubuntu's official images) pick up the key and run
+// arbitrary boot-time customization without shell-escaping into a hand-rolled
+// script.
+func (is *vpcInstanceSet) renderUserData(key *vpcv1.Key) (string, error) {
+	cloudConfig := bytes.Buffer{}
+	if err := vpcCloudConfigTemplate.Execute(&cloudConfig, struct{ PublicKey string }{
+		PublicKey: *key.PublicKey,
+	}); err != nil {
+		return "", fmt.Errorf("failed to render cloud-config: %w", err)
+	}
+	if is.cloudInitExtraYAML != "" {
+		cloudConfig.WriteString("\n")
+		cloudConfig.WriteString(is.cloudInitExtraYAML)
+		cloudConfig.WriteString("\n")
+	}
+
+	mimeBuf := bytes.Buffer{}
+	mimeWriter := multipart.NewWriter(&mimeBuf)
+
+	if err := writeCloudInitPart(mimeWriter, "text/cloud-config", "cloud-config.yaml", cloudConfig.Bytes()); err != nil {
+		return "", err
+	}
+	if is.userData != "" {
+		if err := writeCloudInitPart(mimeWriter, "text/x-shellscript", "user-data.sh", []byte(is.userData)); err != nil {
+			return "", err
+		}
+	}
+	for i, part := range is.cloudInitExtraParts {
+		if err := writeCloudInitPart(mimeWriter, part.contentType, fmt.Sprintf("extra-part-%d", i), part.body); err != nil {
+			return "", err
+		}
+	}
+	if err := mimeWriter.Close(); err != nil {
+		return "", fmt.Errorf("failed to finalize cloud-init mime document: %w", err)
+	}
+
+	return fmt.Sprintf("Content-Type: multipart/mixed; boundary=\"%s\"\nMIME-Version: 1.0\n\n%s",
+		mimeWriter.Boundary(), mimeBuf.String()), nil
+}
+
+func writeCloudInitPart(w *multipart.Writer, contentType, filename string, body []byte) error {
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Type", fmt.Sprintf(`%s; charset="us-ascii"`, contentType))
+	header.Set("MIME-Version", "1.0")
+	header.Set("Content-Transfer-Encoding", "7bit")
+	header.Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+
+	part, err := w.CreatePart(header)
+	if err != nil {
+		return fmt.Errorf("failed to create cloud-init mime part %s: %w", filename, err)
+	}
+	if _, err := part.Write(body); err != nil {
+		return fmt.Errorf("failed to write cloud-init mime part %s: %w", filename, err)
+	}
+	return nil
+}
+
+// parseCloudInitMIMEParts parses the CLOUD_INIT_MIME_PARTS config value: a
+// ';' separated list of "<content-type>,<base64-body>" entries.
+func parseCloudInitMIMEParts(raw string) ([]vpcCloudInitPart, error) {
+	var parts []vpcCloudInitPart
+	for _, entry := range strings.Split(raw, ";") {
+		if entry == "" {
+			continue
+		}
+		pieces := strings.SplitN(entry, ",", 2)
+		if len(pieces) != 2 {
+			return nil, fmt.Errorf("malformed CLOUD_INIT_MIME_PARTS entry %q, want <content-type>,<base64-body>", entry)
+		}
+		body, err := base64.RawURLEncoding.DecodeString(pieces[1])
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode CLOUD_INIT_MIME_PARTS body for %q: %w", pieces[0], err)
+		}
+		parts = append(parts, vpcCloudInitPart{contentType: pieces[0], body: body})
+	}
+	return parts, nil
+}
+
 // waitForInstance blocks until the instance is fully ready. It also returns an
 // updated instance struct with the latest information.
-func (p *vpcProvider) waitForInstance(ctx goctx.Context, instance *vpcv1.Instance, sshDialer *ssh.AuthDialer) (*vpcv1.Instance, error) {
+func (is *vpcInstanceSet) waitForInstance(ctx goctx.Context, instance *vpcv1.Instance, sshDialer *ssh.AuthDialer, progress *vpcProgressReporter) (*vpcv1.Instance, error) {
 	logger := context.LoggerFromContext(ctx).WithFields(logrus.Fields{
 		"self": "backend/vpc", "instance": instance.Name,
 	})
@@ -353,31 +722,37 @@ func (p *vpcProvider) waitForInstance(ctx goctx.Context, instance *vpcv1.Instanc
 	// than just waiting for SSH because we don't know the instance's IP address
 	// until IBM Cloud considers it ready.
 	var (
-		ret *vpcv1.Instance
-		err error
+		ret      *vpcv1.Instance
+		err      error
+		lastSeen string
 	)
-	if err := retryDo(ctx, p.apiRetries, p.sshRetryInterval, func(attempt int) bool {
-		logger.Debugf("probing instance for readiness, attempt %d of %d", attempt, p.apiRetries)
-		ret, _, err = p.service.GetInstanceWithContext(ctx, &vpcv1.GetInstanceOptions{ID: instance.ID})
+	if err := retryDo(ctx, is.apiRetries, is.sshRetryInterval, func(attempt int) bool {
+		logger.Debugf("probing instance for readiness, attempt %d of %d", attempt, is.apiRetries)
+		ret, _, err = is.service.GetInstanceWithContext(ctx, &vpcv1.GetInstanceOptions{ID: instance.ID})
 		if err != nil || *ret.Status != "running" {
 			logger.WithError(err).Debugf("readiness attempt failed, state: %s", *ret.Status)
+			if ret != nil && ret.Status != nil && *ret.Status != lastSeen {
+				lastSeen = *ret.Status
+				progress.stage(fmt.Sprintf("instance status: %s", lastSeen))
+			}
 			return true
 		}
-		logger.Info("instance is running")
+		progress.stage("instance running")
 		return false
 	}); err != nil {
 		return nil, err
 	}
-	return ret, p.waitForInstanceSSH(ctx, instance, *ret.PrimaryNetworkInterface.PrimaryIpv4Address, sshDialer)
+	progress.stage(fmt.Sprintf("IP assigned: %s", *ret.PrimaryNetworkInterface.PrimaryIpv4Address))
+	return ret, is.waitForInstanceSSH(ctx, instance, *ret.PrimaryNetworkInterface.PrimaryIpv4Address, sshDialer, progress)
 }
 
-func (p *vpcProvider) waitForInstanceSSH(ctx goctx.Context, instance *vpcv1.Instance, ip string, sshDialer *ssh.AuthDialer) error {
+func (is *vpcInstanceSet) waitForInstanceSSH(ctx goctx.Context, instance *vpcv1.Instance, ip string, sshDialer *ssh.AuthDialer, progress *vpcProgressReporter) error {
 	logger := context.LoggerFromContext(ctx).WithFields(logrus.Fields{
-		"self": "backend/vpc", "instance": instance.Name, "ip": ip, "username": p.username,
+		"self": "backend/vpc", "instance": instance.Name, "ip": ip, "username": is.username,
 	})
-	return retryDo(ctx, p.sshRetries, p.sshRetryInterval, func(attempt int) bool {
-		logger.Debugf("probing instance for connectivity, attempt %d of %d", attempt, p.sshRetries)
-		conn, err := sshDialer.Dial(fmt.Sprintf("%s:22", ip), p.username, time.Second)
+	return retryDo(ctx, is.sshRetries, is.sshRetryInterval, func(attempt int) bool {
+		logger.Debugf("probing instance for connectivity, attempt %d of %d", attempt, is.sshRetries)
+		conn, err := sshDialer.Dial(fmt.Sprintf("%s:22", ip), is.username, time.Second)
 		if err != nil {
 			logger.WithError(err).Debug("SSH attempt failed")
 			return true
@@ -386,17 +761,18 @@ func (p *vpcProvider) waitForInstanceSSH(ctx goctx.Context, instance *vpcv1.Inst
 			logger.WithError(err).Warn("failed to close SSH test connection")
 		}
 		logger.Info("instance is reachable")
+		progress.stage("SSH handshake succeeded")
 		return false
 	})
 }
 
-func (p *vpcProvider) retryDeleteSSHKey(ctx goctx.Context, key *vpcv1.Key) error {
+func (is *vpcInstanceSet) retryDeleteSSHKey(ctx goctx.Context, key *vpcv1.Key) error {
 	logger := context.LoggerFromContext(ctx).WithFields(logrus.Fields{
 		"self": "backend/vpc", "key": key.Name,
 	})
-	return retryDo(ctx, p.apiRetries, p.apiRetryInterval, func(attempt int) bool {
-		logger.Infof("cleaning up SSH key, attempt %d of %d", attempt, p.apiRetries)
-		if _, err := p.service.DeleteKeyWithContext(ctx, &vpcv1.DeleteKeyOptions{ID: key.ID}); err != nil {
+	return retryDo(ctx, is.apiRetries, is.apiRetryInterval, func(attempt int) bool {
+		logger.Infof("cleaning up SSH key, attempt %d of %d", attempt, is.apiRetries)
+		if _, err := is.service.DeleteKeyWithContext(ctx, &vpcv1.DeleteKeyOptions{ID: key.ID}); err != nil {
 			logger.WithError(err).Debug("cleanup SSH key attempt failed")
 			return true
 		}
@@ -405,32 +781,279 @@ func (p *vpcProvider) retryDeleteSSHKey(ctx goctx.Context, key *vpcv1.Key) error
 	})
 }
 
-func (p *vpcProvider) StartWithProgress(ctx goctx.Context, startAttributes *StartAttributes, _ Progresser) (Instance, error) {
-	return p.Start(ctx, startAttributes)
+func (is *vpcInstanceSet) CreateWithProgress(startAttributes *StartAttributes, progresser Progresser) (Instance, error) {
+	return is.create(startAttributes, progresser)
+}
+
+func (is *vpcInstanceSet) SupportsProgress() bool {
+	return true
+}
+
+// Instances bulk-enumerates every instance visible to this set's
+// credentials in its resource group and VPC, regardless of which process
+// created it, so a caller can reconcile its bookkeeping against reality
+// (e.g. to GC VMs left behind by a worker that crashed mid-Create). Only
+// instances carrying our name prefix are returned. Only the first page of
+// the listing (at most 100 instances) is examined; later pages are not
+// fetched.
+func (is *vpcInstanceSet) Instances() ([]Instance, error) {
+	is.wg.Add(1)
+	defer is.wg.Done()
+	logger := context.LoggerFromContext(is.ctx).WithField("self", "backend/vpc")
+
+	// TODO: page through ListInstancesWithContext if more than `limit`
+	// instances are returned.
+	limit := int64(100)
+	result, _, err := is.service.ListInstancesWithContext(is.ctx, &vpcv1.ListInstancesOptions{
+		ResourceGroupID: &is.resourceGroupID,
+		VPCID:           &is.vpcID,
+		Limit:           &limit,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list vpc instances: %w", err)
+	}
+
+	var instances []Instance
+	for idx := range result.Instances {
+		instance := result.Instances[idx]
+		if instance.Name == nil || !strings.HasPrefix(*instance.Name, vpcInstanceNamePrefix) {
+			continue
+		}
+		instances = append(instances, &vpcInstance{
+			instanceSet: is,
+			instance:    &instance,
+		})
+	}
+	logger.WithField("count", len(instances)).Debug("listed vpc instances")
+	return instances, nil
 }
 
-func (p *vpcProvider) Setup(ctx goctx.Context) error {
-	// All setup is done in newVPCProvider()
+// ReapOrphanedKeys deletes SSH keys carrying our name prefix that aren't
+// attached to any instance Instances currently sees. This cleans up keys
+// left behind when a previous worker process crashed between creating a key
+// and creating the instance it belongs to. Only the first page of the key
+// listing (at most 100 keys) is examined; later pages are not fetched.
+func (is *vpcInstanceSet) ReapOrphanedKeys() error {
+	is.wg.Add(1)
+	defer is.wg.Done()
+	logger := context.LoggerFromContext(is.ctx).WithField("self", "backend/vpc")
+
+	instances, err := is.Instances()
+	if err != nil {
+		return fmt.Errorf("failed to list instances while reaping keys: %w", err)
+	}
+	inUse := map[string]bool{}
+	for _, inst := range instances {
+		vi, ok := inst.(*vpcInstance)
+		if !ok {
+			continue
+		}
+		for _, key := range vi.instance.Keys {
+			if key.ID != nil {
+				inUse[*key.ID] = true
+			}
+		}
+	}
+
+	// TODO: page through ListKeysWithContext if more than `limit` keys exist.
+	limit := int64(100)
+	result, _, err := is.service.ListKeysWithContext(is.ctx, &vpcv1.ListKeysOptions{Limit: &limit})
+	if err != nil {
+		return fmt.Errorf("failed to list ssh keys: %w", err)
+	}
+
+	for idx := range result.Keys {
+		key := result.Keys[idx]
+		if key.Name == nil || key.ID == nil || !strings.HasPrefix(*key.Name, vpcInstanceNamePrefix) {
+			continue
+		}
+		if inUse[*key.ID] {
+			continue
+		}
+		logger.WithField("key", *key.Name).Info("reaping orphaned ssh key")
+		if _, err := is.service.DeleteKeyWithContext(is.ctx, &vpcv1.DeleteKeyOptions{ID: key.ID}); err != nil {
+			logger.WithError(err).WithField("key", *key.Name).Warn("failed to reap orphaned ssh key")
+		}
+	}
 	return nil
 }
 
-func (p *vpcProvider) SupportsProgress() bool {
-	return false
+// ReapOrphans stops every instance Instances sees and then reaps orphaned
+// SSH keys. It is only safe to call before this set has created anything of
+// its own: at worker startup, nothing this process created exists yet, so
+// everything carrying our name prefix must be a VM or key a previous,
+// crashed worker process left running.
+func (is *vpcInstanceSet) ReapOrphans() error {
+	is.wg.Add(1)
+	defer is.wg.Done()
+	logger := context.LoggerFromContext(is.ctx).WithField("self", "backend/vpc")
+
+	instances, err := is.Instances()
+	if err != nil {
+		return fmt.Errorf("failed to list instances while reaping orphans: %w", err)
+	}
+	for _, inst := range instances {
+		logger.WithField("instance", inst.ID()).Info("reaping orphaned instance")
+		if err := inst.Stop(is.ctx); err != nil {
+			logger.WithError(err).WithField("instance", inst.ID()).Warn("failed to reap orphaned instance")
+		}
+	}
+	return is.ReapOrphanedKeys()
+}
+
+// Stop cancels this set's background context and waits for any in-flight
+// Create/Instances calls to return, so the process can exit without leaving
+// cloud API calls running against a torn-down service client.
+func (is *vpcInstanceSet) Stop() {
+	is.cancel()
+	is.wg.Wait()
+}
+
+// generateName produces a name for an instance or SSH key that's unique to
+// this worker process and carries vpcInstanceNamePrefix, so Instances and
+// ReapOrphanedKeys can tell our resources apart from anything else in the
+// resource group.
+func (is *vpcInstanceSet) generateName() (string, error) {
+	suffix := make([]byte, 8)
+	if _, err := rand.Read(suffix); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s%s-%s", vpcInstanceNamePrefix, is.workerID, hex.EncodeToString(suffix)), nil
+}
+
+// vpcProgressReporter turns the stage transitions of a single Create call
+// into ProgressEvents on a Progresser, tagging each with the time elapsed
+// since the call began. A nil Progresser (the plain Create path) makes stage
+// a no-op, so callers don't need to branch on whether progress was
+// requested.
+type vpcProgressReporter struct {
+	progresser Progresser
+	format     string
+	begin      time.Time
+}
+
+func newVPCProgressReporter(progresser Progresser, format string, begin time.Time) *vpcProgressReporter {
+	return &vpcProgressReporter{progresser: progresser, format: format, begin: begin}
+}
+
+func (r *vpcProgressReporter) stage(message string) {
+	if r == nil || r.progresser == nil {
+		return
+	}
+	elapsed := time.Since(r.begin)
+	if r.format == vpcProgressFormatJSON {
+		encoded, err := json.Marshal(struct {
+			Message   string `json:"message"`
+			ElapsedMS int64  `json:"elapsed_ms"`
+		}{Message: message, ElapsedMS: elapsed.Milliseconds()})
+		if err == nil {
+			message = string(encoded)
+		}
+	}
+	r.progresser.Progress(ProgressEvent{Message: message, Elapsed: elapsed})
 }
 
 func (i *vpcInstance) UploadScript(ctx goctx.Context, script []byte) error {
-	// TODO
+	conn, err := i.dialSSH(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to dial instance to upload script: %w", err)
+	}
+	defer conn.Close()
+
+	if err := conn.UploadFile(vpcScriptPath, script); err != nil {
+		return fmt.Errorf("failed to upload build script: %w", err)
+	}
 	return nil
 }
 
 func (i *vpcInstance) RunScript(ctx goctx.Context, writer io.Writer) (*RunResult, error) {
-	// TODO
-	return &RunResult{Completed: true}, nil
+	logger := context.LoggerFromContext(ctx).WithFields(logrus.Fields{
+		"self": "backend/vpc", "instance": i.instance.Name,
+	})
+
+	conn, err := i.dialSSH(ctx)
+	if err != nil {
+		return &RunResult{Completed: false}, fmt.Errorf("failed to dial instance to run script: %w", err)
+	}
+	defer conn.Close()
+
+	// RunCommand blocks until the remote process exits, so watch ctx in the
+	// background and tear down the connection if the build is cancelled. This
+	// is what kills the remote bash process early.
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			logger.Info("context done, killing remote build script")
+			if err := conn.Close(); err != nil {
+				logger.WithError(err).Warn("failed to close SSH connection after cancellation")
+			}
+		case <-done:
+		}
+	}()
+
+	exitStatus, err := conn.RunCommand(fmt.Sprintf("bash --login %s", vpcScriptPath), writer)
+	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return &RunResult{Completed: false}, ctxErr
+		}
+		logger.WithError(err).Warn("lost connection to instance while running script")
+		return &RunResult{Completed: false}, nil
+	}
+
+	return &RunResult{Completed: true, ExitCode: uint8(exitStatus)}, nil
 }
 
 func (i *vpcInstance) DownloadTrace(ctx goctx.Context) ([]byte, error) {
-	// TODO
-	return nil, ErrDownloadTraceNotImplemented
+	conn, err := i.dialSSH(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to dial instance to download trace: %w", err)
+	}
+	defer conn.Close()
+
+	trace, err := conn.DownloadFile(vpcTraceFilePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download trace file: %w", err)
+	}
+	return trace, nil
+}
+
+// dialSSH opens a fresh SSH connection to the instance. Callers are
+// responsible for closing the returned connection. It honors ctx
+// cancellation during the dial itself rather than only once the dial
+// returns, so a canceled build context kills a slow connection attempt
+// instead of waiting out the full vpcSSHDialTimeout.
+func (i *vpcInstance) dialSSH(ctx goctx.Context) (ssh.Connection, error) {
+	if i.sshDialer == nil {
+		return nil, errors.New("instance has no SSH dialer; it was likely discovered via InstanceSet.Instances rather than Create")
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	ip := *i.instance.PrimaryNetworkInterface.PrimaryIpv4Address
+
+	type dialResult struct {
+		conn ssh.Connection
+		err  error
+	}
+	resultChan := make(chan dialResult, 1)
+	go func() {
+		conn, err := i.sshDialer.Dial(fmt.Sprintf("%s:22", ip), i.instanceSet.username, vpcSSHDialTimeout)
+		resultChan <- dialResult{conn: conn, err: err}
+	}()
+
+	select {
+	case <-ctx.Done():
+		go func() {
+			if res := <-resultChan; res.err == nil && res.conn != nil {
+				res.conn.Close()
+			}
+		}()
+		return nil, ctx.Err()
+	case res := <-resultChan:
+		return res.conn, res.err
+	}
 }
 
 func (i *vpcInstance) Stop(ctx goctx.Context) error {
@@ -438,7 +1061,7 @@ func (i *vpcInstance) Stop(ctx goctx.Context) error {
 		"self": "backend/vpc", "instance": i.instance.Name,
 	})
 	logger.Info("cleaning up instance")
-	if _, err := i.provider.service.DeleteInstanceWithContext(ctx, &vpcv1.DeleteInstanceOptions{ID: i.instance.ID}); err != nil {
+	if _, err := i.instanceSet.service.DeleteInstanceWithContext(ctx, &vpcv1.DeleteInstanceOptions{ID: i.instance.ID}); err != nil {
 		return fmt.Errorf("failed to cleanup instance: %w", err)
 	}
 	logger.Debug("cleaned up instance")
@@ -446,16 +1069,24 @@ func (i *vpcInstance) Stop(ctx goctx.Context) error {
 	if err := i.waitForInstanceDeleted(ctx); err != nil {
 		return err
 	}
-	return i.provider.retryDeleteSSHKey(ctx, i.sshKey)
+
+	// Instances discovered via InstanceSet.Instances rather than Create have
+	// no sshKey: we have no way to know which key (if any) an instance we
+	// didn't create is using, so there's nothing for us to clean up here.
+	// ReapOrphanedKeys is responsible for those instead.
+	if i.sshKey == nil {
+		return nil
+	}
+	return i.instanceSet.retryDeleteSSHKey(ctx, i.sshKey)
 }
 
 func (i *vpcInstance) waitForInstanceDeleted(ctx goctx.Context) error {
 	logger := context.LoggerFromContext(ctx).WithFields(logrus.Fields{
 		"self": "backend/vpc", "instance": i.instance.Name,
 	})
-	return retryDo(ctx, i.provider.apiRetries, i.provider.apiRetryInterval, func(attempt int) bool {
-		logger.Infof("probing instance for deletion, attempt %d of %d", attempt, i.provider.apiRetries)
-		instance, res, err := i.provider.service.GetInstanceWithContext(ctx, &vpcv1.GetInstanceOptions{ID: i.instance.ID})
+	return retryDo(ctx, i.instanceSet.apiRetries, i.instanceSet.apiRetryInterval, func(attempt int) bool {
+		logger.Infof("probing instance for deletion, attempt %d of %d", attempt, i.instanceSet.apiRetries)
+		instance, res, err := i.instanceSet.service.GetInstanceWithContext(ctx, &vpcv1.GetInstanceOptions{ID: i.instance.ID})
 		if res.StatusCode != http.StatusNotFound {
 			logger.WithError(err).Debugf("instance still running, state: %s", *instance.Status)
 			return true
@@ -478,7 +1109,7 @@ func (i *vpcInstance) ImageName() string {
 }
 
 func (i *vpcInstance) Warmed() bool {
-	return false
+	return i.warmed
 }
 
 func (i *vpcInstance) SupportsProgress() bool {
@@ -499,4 +1130,4 @@ func retryDo(ctx goctx.Context, retries int, retryInterval time.Duration, fn fun
 		}
 	}
 	return errors.New("retry limit exceeded")
-}
\ No newline at end of file
+}
@@ -1,10 +1,12 @@
 package main
 
 import (
+	goctx "context"
 	"fmt"
 	"log"
 	"os"
 	"os/signal"
+	"strconv"
 	"time"
 
 	"github.com/Sirupsen/logrus"
@@ -13,10 +15,10 @@ import (
 	"github.com/rcrowley/go-metrics"
 	"github.com/rcrowley/go-metrics/librato"
 	"github.com/streadway/amqp"
+	"github.com/travis-ci/worker/backend"
+	"github.com/travis-ci/worker/config"
+	"github.com/travis-ci/worker/context"
 	"github.com/travis-ci/worker/lib"
-	"github.com/travis-ci/worker/lib/backend"
-	"github.com/travis-ci/worker/lib/context"
-	gocontext "golang.org/x/net/context"
 )
 
 func main() {
@@ -29,7 +31,7 @@ func main() {
 }
 
 func runWorker(c *cli.Context) {
-	ctx := gocontext.Background()
+	ctx := goctx.Background()
 	logger := context.LoggerFromContext(ctx)
 
 	config := lib.EnvToConfig()
@@ -61,21 +63,40 @@ func runWorker(c *cli.Context) {
 	context.LoggerFromContext(ctx).Debug("connected to AMQP")
 
 	generator := lib.NewBuildScriptGenerator(config.BuildAPIURI)
-	provider, err := backend.NewProvider(config.ProviderName, config.ProviderConfig)
+	instanceSet, err := backend.NewInstanceSet(config.ProviderName, config.ProviderConfig)
 	if err != nil {
-		context.LoggerFromContext(ctx).WithField("err", err).Error("couldn't create backend provider")
+		context.LoggerFromContext(ctx).WithField("err", err).Error("couldn't create backend instance set")
 		return
 	}
 
+	// Nothing this process has created exists yet, so anything a backend
+	// finds lying around must have been left behind by a worker that
+	// crashed before it could clean up after itself.
+	if reaper, ok := instanceSet.(backend.OrphanReaper); ok {
+		context.LoggerFromContext(ctx).Info("reaping instances and ssh keys left behind by a previous worker process")
+		if err := reaper.ReapOrphans(); err != nil {
+			context.LoggerFromContext(ctx).WithField("err", err).Warn("failed to reap orphaned resources")
+		}
+	}
+
+	// Wrap every backend in a warm pool so Create/CreateWithProgress can skip
+	// the cold-start path on the common case.
+	poolSize, poolMaxAge, err := poolConfig(config.ProviderConfig)
+	if err != nil {
+		context.LoggerFromContext(ctx).WithField("err", err).Error("invalid instance pool config")
+		return
+	}
+	pooledInstanceSet := backend.NewInstancePool(instanceSet, poolSize, poolMaxAge)
+
 	commandDispatcher := lib.NewCommandDispatcher(ctx, amqpConn)
 	go commandDispatcher.Run()
 
 	pool := &lib.ProcessorPool{
-		Context:   ctx,
-		Conn:      amqpConn,
-		Provider:  provider,
-		Generator: generator,
-		Canceller: commandDispatcher,
+		Context:     ctx,
+		Conn:        amqpConn,
+		InstanceSet: pooledInstanceSet,
+		Generator:   generator,
+		Canceller:   commandDispatcher,
 	}
 
 	signalChan := make(chan os.Signal, 1)
@@ -84,6 +105,7 @@ func runWorker(c *cli.Context) {
 		<-signalChan
 		context.LoggerFromContext(ctx).Info("SIGTERM received, starting graceful shutdown")
 		pool.GracefulShutdown()
+		pooledInstanceSet.Stop()
 	}()
 
 	pool.Run(config.PoolSize, config.QueueName)
@@ -93,4 +115,31 @@ func runWorker(c *cli.Context) {
 		context.LoggerFromContext(ctx).WithField("err", err).Error("couldn't close AMQP connection cleanly")
 		return
 	}
-}
\ No newline at end of file
+}
+
+// poolConfig reads the warm-instance-pool knobs out of the provider config:
+// POOL_SIZE (instances kept warm per StartAttributes bucket) and
+// POOL_MAX_AGE (how long a warm instance sits before being recycled, e.g.
+// '1h'). Either is left at 0 (InstancePool's "use the default" value) if
+// unset, so NewInstancePool falls back to its built-in defaults.
+func poolConfig(cfg *config.ProviderConfig) (int, time.Duration, error) {
+	var (
+		size   int
+		maxAge time.Duration
+	)
+	if cfg.IsSet("POOL_SIZE") {
+		n, err := strconv.ParseInt(cfg.Get("POOL_SIZE"), 0, 32)
+		if err != nil {
+			return 0, 0, fmt.Errorf("invalid POOL_SIZE: %w", err)
+		}
+		size = int(n)
+	}
+	if cfg.IsSet("POOL_MAX_AGE") {
+		d, err := time.ParseDuration(cfg.Get("POOL_MAX_AGE"))
+		if err != nil {
+			return 0, 0, fmt.Errorf("invalid POOL_MAX_AGE: %w", err)
+		}
+		maxAge = d
+	}
+	return size, maxAge, nil
+}